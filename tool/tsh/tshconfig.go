@@ -17,10 +17,18 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
+	"os/user"
 	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
 
 	"github.com/gravitational/teleport/api/profile"
 
@@ -36,11 +44,26 @@ const tshConfigPath = "config/config.yaml"
 // default location of global tsh config file.
 const globalTshConfigPathDefault = "/etc/tsh.yaml"
 
+// maxIncludeDepth caps how many levels of nested "include" directives
+// loadConfig will follow, guarding against runaway recursion.
+const maxIncludeDepth = 8
+
 // TshConfig represents configuration loaded from the tsh config file.
 type TshConfig struct {
 	// ExtraHeaders are additional http headers to be included in
 	// webclient requests.
 	ExtraHeaders []ExtraProxyHeaders `yaml:"add_headers,omitempty"`
+	// StrictTemplates, when true, causes config template rendering to
+	// fail if a referenced map key (e.g. an unset .Env variable) is
+	// missing instead of rendering it as the zero value.
+	StrictTemplates bool `yaml:"strict_templates,omitempty"`
+	// Include is a list of glob patterns, resolved relative to the
+	// directory of the config file they appear in, identifying other tsh
+	// config files to load and merge into this one.
+	Include []string `yaml:"include,omitempty"`
+	// ProxyTemplates is a list of rules for rewriting the proxy and
+	// cluster used to connect to an SSH target based on its hostname.
+	ProxyTemplates []ProxyTemplate `yaml:"proxy_templates,omitempty"`
 }
 
 // ExtraProxyHeaders represents the headers to include with the
@@ -52,6 +75,101 @@ type ExtraProxyHeaders struct {
 	Headers map[string]string `yaml:"headers,omitempty"`
 }
 
+// ProxyTemplate defines a rule for rewriting the proxy and cluster used to
+// dial an SSH target based on a regexp match against its hostname.
+type ProxyTemplate struct {
+	// Template is a regexp matched against the hostname given to
+	// tsh ssh. It may contain capture groups referenced by Proxy,
+	// Cluster and Host as $1, $2, etc.
+	Template string `yaml:"template"`
+	// Proxy is the proxy address to use instead of the configured
+	// default, may reference capture groups from Template.
+	Proxy string `yaml:"proxy,omitempty"`
+	// Cluster is the cluster to use instead of the configured default,
+	// may reference capture groups from Template.
+	Cluster string `yaml:"cluster,omitempty"`
+	// Host is the rewritten target hostname to dial, may reference
+	// capture groups from Template. Defaults to the original hostname
+	// when empty.
+	Host string `yaml:"host,omitempty"`
+
+	// re is Template compiled by CheckAndSetDefaults.
+	re *regexp.Regexp
+}
+
+// CheckAndSetDefaults validates the template and compiles its regexp.
+func (t *ProxyTemplate) CheckAndSetDefaults() error {
+	if t.Template == "" {
+		return trace.BadParameter("proxy template is missing a \"template\" regexp")
+	}
+	re, err := regexp.Compile(t.Template)
+	if err != nil {
+		return trace.BadParameter("invalid proxy template regexp %q: %v", t.Template, err)
+	}
+	t.re = re
+	return nil
+}
+
+// Apply matches host against the template and, if it matches, returns the
+// rewritten proxy, cluster and host with capture groups expanded.
+func (t *ProxyTemplate) Apply(host string) (proxy, cluster, newHost string, matched bool) {
+	if t.re == nil {
+		return "", "", "", false
+	}
+
+	idx := t.re.FindStringSubmatchIndex(host)
+	if idx == nil {
+		return "", "", "", false
+	}
+
+	expand := func(repl string) string {
+		return string(t.re.ExpandString(nil, repl, host, idx))
+	}
+
+	newHost = host
+	if t.Host != "" {
+		newHost = expand(t.Host)
+	}
+	return expand(t.Proxy), expand(t.Cluster), newHost, true
+}
+
+// ApplyProxyTemplates evaluates templates, in order, against host and
+// returns the rewritten proxy/cluster/host from the first match.
+func ApplyProxyTemplates(templates []ProxyTemplate, host string) (proxy, cluster, newHost string, matched bool) {
+	for _, t := range templates {
+		if proxy, cluster, newHost, matched = t.Apply(host); matched {
+			return proxy, cluster, newHost, true
+		}
+	}
+	return "", "", "", false
+}
+
+// ResolveSSHProxyTemplate is the entry point tsh ssh's dial path should
+// call before dialing a target: it applies templates to host and, on a
+// match, prints a one-line notice (unless quiet is set) describing the
+// rewritten proxy/cluster. An explicit jump host (-J) always takes
+// precedence over an implicit template rewrite, so templates are skipped
+// entirely when hasJumpHost is true.
+//
+// TODO: tsh.go's ssh command isn't part of this checkout, so nothing
+// calls this yet; wire it into the dial path once that file exists.
+func ResolveSSHProxyTemplate(templates []ProxyTemplate, host string, hasJumpHost, quiet bool) (proxy, cluster, newHost string, matched bool) {
+	if hasJumpHost {
+		return "", "", "", false
+	}
+
+	proxy, cluster, newHost, matched = ApplyProxyTemplates(templates, host)
+	if !matched {
+		return "", "", "", false
+	}
+
+	if !quiet {
+		fmt.Printf("Note: proxy template matched %q, connecting to proxy %q, cluster %q\n", host, proxy, cluster)
+	}
+
+	return proxy, cluster, newHost, true
+}
+
 // Merge two configs into one. The passed in otherConfig argument has higher priority.
 func (config *TshConfig) Merge(otherConfig *TshConfig) TshConfig {
 	baseConfig := config
@@ -68,11 +186,115 @@ func (config *TshConfig) Merge(otherConfig *TshConfig) TshConfig {
 	// extra headers
 	newConfig.ExtraHeaders = append(baseConfig.ExtraHeaders, otherConfig.ExtraHeaders...)
 
+	// proxy templates: the higher-priority config's templates are
+	// evaluated first, so they take precedence under first-match-wins.
+	newConfig.ProxyTemplates = append(otherConfig.ProxyTemplates, baseConfig.ProxyTemplates...)
+
 	return newConfig
 }
 
-// loadConfig load a single config file from given path. If the path does not exist, an empty config is returned instead.
-func loadConfig(fullConfigPath string) (*TshConfig, error) {
+// configTemplateContext is exposed to tsh config files as the template "."
+// value, letting users pull values from the environment, the current OS
+// user and the active profile/proxy instead of hardcoding them.
+type configTemplateContext struct {
+	// Env is the current process environment, keyed by variable name.
+	Env map[string]string
+	// User is the name of the current OS user.
+	User string
+	// Home is the resolved full profile path (i.e. ~/.tsh).
+	Home string
+	// Proxy is the proxy currently in use, as set on the CLI or profile.
+	Proxy string
+}
+
+// newConfigTemplateContext builds the template context used to render a tsh
+// config file loaded for the given CLIConf.
+func newConfigTemplateContext(cf CLIConf) configTemplateContext {
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			env[k] = v
+		}
+	}
+
+	userName := ""
+	if u, err := user.Current(); err == nil {
+		userName = u.Username
+	}
+
+	return configTemplateContext{
+		Env:   env,
+		User:  userName,
+		Home:  profile.FullProfilePath(cf.HomePath),
+		Proxy: cf.Proxy,
+	}
+}
+
+// configTemplateFuncs are the helper functions available to tsh config
+// templates, in addition to the builtin text/template funcs.
+func configTemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"env": func(name string) string {
+			return os.Getenv(name)
+		},
+		"default": func(def, val string) string {
+			if val == "" {
+				return def
+			}
+			return val
+		},
+		"trim": strings.TrimSpace,
+		// quote renders s as a double-quoted, escaped YAML scalar, so a
+		// templated value containing quotes, colons or other
+		// YAML-significant characters doesn't corrupt the document it's
+		// substituted into. Values inlined into an already-quoted scalar
+		// (e.g. "Bearer {{ env "TOKEN" }}") should not also be quoted.
+		"quote": strconv.Quote,
+	}
+}
+
+// renderConfigTemplate renders bs as a text/template using the given CLIConf
+// to build the template context. Files that contain no template actions are
+// returned unmodified, so plain YAML configs keep working exactly as before.
+func renderConfigTemplate(bs []byte, cf CLIConf, strict bool) ([]byte, error) {
+	if !bytes.Contains(bs, []byte("{{")) {
+		return bs, nil
+	}
+
+	tmpl := template.New("tsh_config").Funcs(configTemplateFuncs())
+	if strict {
+		tmpl = tmpl.Option("missingkey=error")
+	} else {
+		// Without this, a missing map key (e.g. an unset .Env var)
+		// renders as the literal string "<no value>" instead of "",
+		// which is Go's text/template default and not what a tsh config
+		// author would expect from an optional value.
+		tmpl = tmpl.Option("missingkey=zero")
+	}
+
+	tmpl, err := tmpl.Parse(string(bs))
+	if err != nil {
+		return nil, trace.Wrap(err, "failed to parse tsh config template")
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, newConfigTemplateContext(cf)); err != nil {
+		return nil, trace.Wrap(err, "failed to render tsh config template")
+	}
+	return out.Bytes(), nil
+}
+
+// loadConfig load a single config file from given path, expanding any
+// "include" directives it contains. If the path does not exist, an empty
+// config is returned instead.
+func loadConfig(fullConfigPath string, cf CLIConf) (*TshConfig, error) {
+	return loadConfigWithIncludes(fullConfigPath, cf, make(map[string]bool), 0)
+}
+
+// loadConfigWithIncludes loads fullConfigPath and recursively expands its
+// "include" directives, tracking visited absolute paths to detect cycles
+// and capping recursion at maxIncludeDepth.
+func loadConfigWithIncludes(fullConfigPath string, cf CLIConf, visited map[string]bool, depth int) (*TshConfig, error) {
 	bs, err := os.ReadFile(fullConfigPath)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
@@ -81,14 +303,81 @@ func loadConfig(fullConfigPath string) (*TshConfig, error) {
 		return nil, trace.ConvertSystemError(err)
 	}
 
+	// strict_templates lives inside the template-able file itself, so it
+	// can't be known before a first render. Render non-strict first; if
+	// that turns out to have asked for strict mode, re-render strictly
+	// against the original bytes so a missing key is still caught. We
+	// can't YAML-parse bs itself to peek at the flag, because bs may not
+	// be valid YAML until the template actions in it are substituted.
+	rendered, err := renderConfigTemplate(bs, cf, false)
+	if err != nil {
+		return nil, trace.Wrap(err)
+	}
+
 	cfg := TshConfig{}
-	if err := yaml.Unmarshal(bs, &cfg); err != nil {
+	if err := yaml.Unmarshal(rendered, &cfg); err != nil {
 		return nil, trace.ConvertSystemError(err)
 	}
-	return &cfg, nil
+
+	if cfg.StrictTemplates {
+		rendered, err = renderConfigTemplate(bs, cf, true)
+		if err != nil {
+			return nil, trace.Wrap(err)
+		}
+		cfg = TshConfig{}
+		if err := yaml.Unmarshal(rendered, &cfg); err != nil {
+			return nil, trace.ConvertSystemError(err)
+		}
+	}
+
+	if len(cfg.Include) == 0 {
+		return &cfg, nil
+	}
+
+	absConfigPath, err := filepath.Abs(fullConfigPath)
+	if err != nil {
+		return nil, trace.ConvertSystemError(err)
+	}
+	if visited[absConfigPath] {
+		return nil, trace.BadParameter("tsh config include cycle detected at %q", fullConfigPath)
+	}
+	if depth >= maxIncludeDepth {
+		return nil, trace.BadParameter("tsh config include depth exceeded %d levels at %q", maxIncludeDepth, fullConfigPath)
+	}
+
+	visited[absConfigPath] = true
+	defer delete(visited, absConfigPath)
+
+	includeDir := filepath.Dir(fullConfigPath)
+	includedConf := TshConfig{}
+	for _, pattern := range cfg.Include {
+		matches, err := filepath.Glob(filepath.Join(includeDir, pattern))
+		if err != nil {
+			return nil, trace.BadParameter("invalid include pattern %q in %q: %v", pattern, fullConfigPath, err)
+		}
+		if len(matches) == 0 {
+			return nil, trace.BadParameter("include pattern %q in %q matched no files", pattern, fullConfigPath)
+		}
+		sort.Strings(matches)
+
+		for _, match := range matches {
+			matchConf, err := loadConfigWithIncludes(match, cf, visited, depth+1)
+			if err != nil {
+				return nil, trace.Wrap(err, "failed to load tsh config included from %q", fullConfigPath)
+			}
+			includedConf = includedConf.Merge(matchConf)
+		}
+	}
+
+	// The including file's own inline values take precedence over
+	// anything pulled in via include.
+	cfg.Include = nil
+	merged := includedConf.Merge(&cfg)
+	return &merged, nil
 }
 
-// loadAllConfigs loads all tsh configs and merges them in appropriate order.
+// loadAllConfigs loads all tsh configs, expanding any "include" directives
+// they contain, and merges them in appropriate order.
 func loadAllConfigs(cf CLIConf) (*TshConfig, error) {
 	// default to globalTshConfigPathDefault
 	globalConfigPath := cf.GlobalTshConfigPath
@@ -96,17 +385,24 @@ func loadAllConfigs(cf CLIConf) (*TshConfig, error) {
 		globalConfigPath = globalTshConfigPathDefault
 	}
 
-	globalConf, err := loadConfig(globalConfigPath)
+	globalConf, err := loadConfig(globalConfigPath, cf)
 	if err != nil {
 		return nil, trace.Wrap(err, "failed to load global tsh config from %q", cf.GlobalTshConfigPath)
 	}
 
 	fullConfigPath := filepath.Join(profile.FullProfilePath(cf.HomePath), tshConfigPath)
-	userConf, err := loadConfig(fullConfigPath)
+	userConf, err := loadConfig(fullConfigPath, cf)
 	if err != nil {
 		return nil, trace.Wrap(err, "failed to load tsh config from %q", fullConfigPath)
 	}
 
 	confOptions := globalConf.Merge(userConf)
+
+	for i := range confOptions.ProxyTemplates {
+		if err := confOptions.ProxyTemplates[i].CheckAndSetDefaults(); err != nil {
+			return nil, trace.Wrap(err)
+		}
+	}
+
 	return &confOptions, nil
 }
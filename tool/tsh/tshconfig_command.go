@@ -0,0 +1,136 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gravitational/trace"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// configCommand implements "tsh config" and its subcommands, mirroring the
+// show/validate/add-headers/remove-headers/set helpers in
+// tshconfig_edit.go. Not yet reachable: tsh.go's top-level command table
+// isn't part of this checkout, so until it calls newConfigCommand(app) the
+// way it wires up tsh's other subcommand groups, nothing in this file runs.
+type configCommand struct {
+	show       *kingpin.CmdClause
+	showFormat *string
+
+	validate *kingpin.CmdClause
+
+	addHeaders      *kingpin.CmdClause
+	addHeadersProxy *string
+	addHeadersPairs *[]string
+
+	removeHeaders      *kingpin.CmdClause
+	removeHeadersProxy *string
+
+	set      *kingpin.CmdClause
+	setPath  *string
+	setValue *string
+
+	global *bool
+}
+
+// newConfigCommand registers "tsh config" and its subcommands under app.
+//
+// TODO: tsh.go's top-level command table isn't part of this checkout, so
+// nothing calls newConfigCommand yet; add that one-line call the same way
+// tsh's other subcommand groups are wired up once that file exists.
+func newConfigCommand(app *kingpin.Application) *configCommand {
+	c := &configCommand{}
+
+	cmd := app.Command("config", "Manage the tsh config file.")
+	c.global = cmd.Flag("global", "Operate on the global tsh config instead of the user config.").Bool()
+
+	c.show = cmd.Command("show", "Print the effective, merged tsh config.")
+	c.showFormat = c.show.Flag("format", "Output format.").Default("yaml").Enum("json", "yaml")
+
+	c.validate = cmd.Command("validate", "Parse and semantically check the tsh config.")
+
+	c.addHeaders = cmd.Command("add-headers", "Add extra HTTP headers for a proxy.")
+	c.addHeadersProxy = c.addHeaders.Arg("proxy", "Proxy address these headers apply to.").Required().String()
+	c.addHeadersPairs = c.addHeaders.Arg("headers", "One or more key=value header pairs.").Required().Strings()
+
+	c.removeHeaders = cmd.Command("remove-headers", "Remove extra HTTP headers for a proxy.")
+	c.removeHeadersProxy = c.removeHeaders.Arg("proxy", "Proxy address to remove headers for.").Required().String()
+
+	c.set = cmd.Command("set", "Set a single config value by dotted yaml path.")
+	c.setPath = c.set.Arg("yaml-path", "Dotted path of the value to set, e.g. strict_templates.").Required().String()
+	c.setValue = c.set.Arg("value", "Value to set.").Required().String()
+
+	return c
+}
+
+// run dispatches cmdName, as returned by (*kingpin.Application).Parse, to
+// the matching "tsh config" subcommand.
+func (c *configCommand) run(cf *CLIConf, cmdName string) error {
+	switch cmdName {
+	case c.show.FullCommand():
+		out, err := showTshConfig(*cf, *c.showFormat)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		fmt.Println(out)
+		return nil
+
+	case c.validate.FullCommand():
+		errs := validateTshConfig(*cf)
+		if len(errs) == 0 {
+			fmt.Println("tsh config is valid")
+			return nil
+		}
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return trace.BadParameter("tsh config is invalid:\n%s", strings.Join(msgs, "\n"))
+
+	case c.addHeaders.FullCommand():
+		headers, err := parseHeaderPairs(*c.addHeadersPairs)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		return trace.Wrap(addConfigHeaders(*cf, *c.global, *c.addHeadersProxy, headers))
+
+	case c.removeHeaders.FullCommand():
+		return trace.Wrap(removeConfigHeaders(*cf, *c.global, *c.removeHeadersProxy))
+
+	case c.set.FullCommand():
+		return trace.Wrap(setConfigValue(*cf, *c.global, *c.setPath, *c.setValue))
+
+	default:
+		return trace.BadParameter("unrecognized tsh config subcommand %q", cmdName)
+	}
+}
+
+// parseHeaderPairs parses "key=value" strings into a map, as accepted by
+// "tsh config add-headers".
+func parseHeaderPairs(pairs []string) (map[string]string, error) {
+	headers := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, trace.BadParameter("invalid header %q, expected key=value", pair)
+		}
+		headers[k] = v
+	}
+	return headers, nil
+}
@@ -0,0 +1,344 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This file implements the read/write logic behind the "tsh config" command
+// family (show, validate, add-headers, remove-headers, set); see
+// tshconfig_command.go for the kingpin command definitions and dispatch
+// that call into the functions below.
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/gravitational/teleport/api/profile"
+
+	"github.com/gravitational/trace"
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// tshConfigTmpSuffix is appended to the config file path while a mutating
+// "tsh config" subcommand writes its result, so a crash or power loss
+// mid-write can never leave config.yaml truncated or corrupt.
+const tshConfigTmpSuffix = ".tmp"
+
+// tshConfigEditPath returns the config file that "tsh config" subcommands
+// read and write: the user-scope config.yaml, or the global one when global
+// is true.
+func tshConfigEditPath(cf CLIConf, global bool) string {
+	if global {
+		if cf.GlobalTshConfigPath != "" {
+			return cf.GlobalTshConfigPath
+		}
+		return globalTshConfigPathDefault
+	}
+	return filepath.Join(profile.FullProfilePath(cf.HomePath), tshConfigPath)
+}
+
+// showTshConfig renders the effective, merged tsh config (global and user
+// scope combined) as YAML or JSON for "tsh config show".
+func showTshConfig(cf CLIConf, format string) (string, error) {
+	conf, err := loadAllConfigs(cf)
+	if err != nil {
+		return "", trace.Wrap(err)
+	}
+
+	switch format {
+	case "", "yaml":
+		bs, err := yaml.Marshal(conf)
+		if err != nil {
+			return "", trace.Wrap(err)
+		}
+		return string(bs), nil
+	case "json":
+		bs, err := json.MarshalIndent(conf, "", "  ")
+		if err != nil {
+			return "", trace.Wrap(err)
+		}
+		return string(bs), nil
+	default:
+		return "", trace.BadParameter("unsupported format %q, must be one of json, yaml", format)
+	}
+}
+
+// validateTshConfig parses and semantically checks the effective tsh config,
+// returning the errors found for "tsh config validate" to report. Loading
+// stops at the first error, so at most one error is returned.
+func validateTshConfig(cf CLIConf) []error {
+	var errs []error
+	if _, err := loadAllConfigs(cf); err != nil {
+		errs = append(errs, trace.Wrap(err))
+	}
+	return errs
+}
+
+// readConfigDocument reads path into a yaml.v3 document node, preserving
+// comments and formatting for later re-marshaling. A missing file yields an
+// empty mapping document rather than an error, matching loadConfig.
+func readConfigDocument(path string) (*yamlv3.Node, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &yamlv3.Node{
+				Kind:    yamlv3.DocumentNode,
+				Content: []*yamlv3.Node{{Kind: yamlv3.MappingNode, Tag: "!!map"}},
+			}, nil
+		}
+		return nil, trace.ConvertSystemError(err)
+	}
+
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(bs, &doc); err != nil {
+		return nil, trace.Wrap(err, "failed to parse %q", path)
+	}
+	if len(doc.Content) == 0 {
+		doc.Kind = yamlv3.DocumentNode
+		doc.Content = []*yamlv3.Node{{Kind: yamlv3.MappingNode, Tag: "!!map"}}
+	}
+	return &doc, nil
+}
+
+// writeConfigDocument marshals doc and writes it to path atomically, by
+// writing to a temporary file in the same directory and renaming it over
+// path, so a reader never observes a partial write.
+func writeConfigDocument(path string, doc *yamlv3.Node) error {
+	bs, err := yamlv3.Marshal(doc)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+
+	tmpPath := path + tshConfigTmpSuffix
+	if err := os.WriteFile(tmpPath, bs, 0o600); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return trace.ConvertSystemError(err)
+	}
+	return nil
+}
+
+// mappingRoot returns the top-level mapping node of doc, which is always
+// doc.Content[0] for a document produced by readConfigDocument.
+func mappingRoot(doc *yamlv3.Node) *yamlv3.Node {
+	return doc.Content[0]
+}
+
+// mappingGet returns the value node for key in a mapping node, or nil if
+// key is not present.
+func mappingGet(mapping *yamlv3.Node, key string) *yamlv3.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mappingSet sets key to value in a mapping node, replacing any existing
+// entry for key or appending a new one.
+func mappingSet(mapping *yamlv3.Node, key string, value *yamlv3.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	keyNode := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: key}
+	mapping.Content = append(mapping.Content, keyNode, value)
+}
+
+// scalarNode builds a plain scalar yaml.v3 node for s, leaving Tag unset so
+// Marshal infers it from the content (e.g. "true" round-trips as a bool,
+// not a force-quoted string) the same way a value typed directly into the
+// config file would.
+func scalarNode(s string) *yamlv3.Node {
+	return &yamlv3.Node{Kind: yamlv3.ScalarNode, Value: s}
+}
+
+// addConfigHeaders implements "tsh config add-headers <proxy> <k=v>...": it
+// adds the given headers to the add_headers entry for proxy, creating the
+// entry if there is none. Headers already in the entry under other keys are
+// kept; those under the same keys are overwritten.
+func addConfigHeaders(cf CLIConf, global bool, proxy string, headers map[string]string) error {
+	path := tshConfigEditPath(cf, global)
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	root := mappingRoot(doc)
+
+	addHeaders := mappingGet(root, "add_headers")
+	if addHeaders == nil {
+		addHeaders = &yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+		mappingSet(root, "add_headers", addHeaders)
+	}
+
+	var entry *yamlv3.Node
+	for _, item := range addHeaders.Content {
+		if p := mappingGet(item, "proxy"); p != nil && p.Value == proxy {
+			entry = item
+			break
+		}
+	}
+	if entry == nil {
+		entry = &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		mappingSet(entry, "proxy", scalarNode(proxy))
+		addHeaders.Content = append(addHeaders.Content, entry)
+	}
+
+	headersNode := mappingGet(entry, "headers")
+	if headersNode == nil {
+		headersNode = &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		mappingSet(entry, "headers", headersNode)
+	}
+	for k, v := range headers {
+		mappingSet(headersNode, k, scalarNode(v))
+	}
+
+	return trace.Wrap(writeConfigDocument(path, doc))
+}
+
+// removeConfigHeaders implements "tsh config remove-headers <proxy>": it
+// drops the add_headers entry for proxy, if any.
+func removeConfigHeaders(cf CLIConf, global bool, proxy string) error {
+	path := tshConfigEditPath(cf, global)
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+	root := mappingRoot(doc)
+
+	addHeaders := mappingGet(root, "add_headers")
+	if addHeaders == nil {
+		return nil
+	}
+
+	kept := addHeaders.Content[:0]
+	for _, item := range addHeaders.Content {
+		if p := mappingGet(item, "proxy"); p != nil && p.Value == proxy {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	addHeaders.Content = kept
+
+	return trace.Wrap(writeConfigDocument(path, doc))
+}
+
+// setConfigValue implements "tsh config set <yaml-path> <value>" for dotted
+// paths of mapping keys and sequence indices, e.g. "strict_templates" or
+// "proxy_templates.0.proxy". Mapping segments are created as needed;
+// sequence segments (integer path components) must already exist, since
+// there's no sane default length to create a sequence at.
+func setConfigValue(cf CLIConf, global bool, yamlPath, value string) error {
+	keys := splitConfigPath(yamlPath)
+	if len(keys) == 0 {
+		return trace.BadParameter("empty yaml path")
+	}
+
+	path := tshConfigEditPath(cf, global)
+	doc, err := readConfigDocument(path)
+	if err != nil {
+		return trace.Wrap(err)
+	}
+
+	node := mappingRoot(doc)
+	for _, key := range keys[:len(keys)-1] {
+		next, err := descendConfigPath(node, key, yamlPath, true /* create */)
+		if err != nil {
+			return trace.Wrap(err)
+		}
+		node = next
+	}
+
+	lastKey := keys[len(keys)-1]
+	if idx, ok := sequenceIndex(lastKey); ok {
+		if node.Kind != yamlv3.SequenceNode {
+			return trace.BadParameter("%q is not a sequence in %s", lastKey, yamlPath)
+		}
+		if idx < 0 || idx >= len(node.Content) {
+			return trace.BadParameter("index %d out of range for %q in %s", idx, lastKey, yamlPath)
+		}
+		node.Content[idx] = scalarNode(value)
+	} else {
+		mappingSet(node, lastKey, scalarNode(value))
+	}
+
+	return trace.Wrap(writeConfigDocument(path, doc))
+}
+
+// sequenceIndex reports whether key is a non-negative integer sequence
+// index, e.g. "0" in "proxy_templates.0.proxy".
+func sequenceIndex(key string) (int, bool) {
+	idx, err := strconv.Atoi(key)
+	if err != nil || idx < 0 {
+		return 0, false
+	}
+	return idx, true
+}
+
+// descendConfigPath moves from node into the child identified by key, which
+// may be a mapping key or, for a sequence node, an integer index. When
+// create is true, a missing mapping key is created as an empty mapping;
+// sequence indices are never auto-created.
+func descendConfigPath(node *yamlv3.Node, key, yamlPath string, create bool) (*yamlv3.Node, error) {
+	if idx, ok := sequenceIndex(key); ok {
+		if node.Kind != yamlv3.SequenceNode {
+			return nil, trace.BadParameter("%q is not a sequence in %s", key, yamlPath)
+		}
+		if idx < 0 || idx >= len(node.Content) {
+			return nil, trace.BadParameter("index %d out of range for %q in %s", idx, key, yamlPath)
+		}
+		return node.Content[idx], nil
+	}
+
+	if node.Kind != yamlv3.MappingNode {
+		return nil, trace.BadParameter("%q is not a mapping in %s", key, yamlPath)
+	}
+	next := mappingGet(node, key)
+	if next == nil {
+		if !create {
+			return nil, trace.BadParameter("%q not found in %s", key, yamlPath)
+		}
+		next = &yamlv3.Node{Kind: yamlv3.MappingNode, Tag: "!!map"}
+		mappingSet(node, key, next)
+	}
+	return next, nil
+}
+
+// splitConfigPath splits a dotted yaml path like "a.b.c" into its segments.
+func splitConfigPath(yamlPath string) []string {
+	var keys []string
+	start := 0
+	for i := 0; i < len(yamlPath); i++ {
+		if yamlPath[i] == '.' {
+			keys = append(keys, yamlPath[start:i])
+			start = i + 1
+		}
+	}
+	keys = append(keys, yamlPath[start:])
+	return keys
+}
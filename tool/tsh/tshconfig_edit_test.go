@@ -0,0 +1,100 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddAndRemoveConfigHeaders(t *testing.T) {
+	dir := t.TempDir()
+	cf := CLIConf{HomePath: dir}
+
+	require.NoError(t, addConfigHeaders(cf, false, "example.com", map[string]string{"X-Foo": "bar"}))
+
+	cfg, err := loadConfig(filepath.Join(dir, tshConfigPath), cf)
+	require.NoError(t, err)
+	require.Len(t, cfg.ExtraHeaders, 1)
+	require.Equal(t, "example.com", cfg.ExtraHeaders[0].Proxy)
+	require.Equal(t, "bar", cfg.ExtraHeaders[0].Headers["X-Foo"])
+
+	// Adding again for the same proxy merges into the existing entry
+	// rather than creating a second one.
+	require.NoError(t, addConfigHeaders(cf, false, "example.com", map[string]string{"X-Baz": "qux"}))
+	cfg, err = loadConfig(filepath.Join(dir, tshConfigPath), cf)
+	require.NoError(t, err)
+	require.Len(t, cfg.ExtraHeaders, 1)
+	require.Equal(t, "bar", cfg.ExtraHeaders[0].Headers["X-Foo"])
+	require.Equal(t, "qux", cfg.ExtraHeaders[0].Headers["X-Baz"])
+
+	require.NoError(t, removeConfigHeaders(cf, false, "example.com"))
+	cfg, err = loadConfig(filepath.Join(dir, tshConfigPath), cf)
+	require.NoError(t, err)
+	require.Empty(t, cfg.ExtraHeaders)
+}
+
+func TestSetConfigValue_MappingPath(t *testing.T) {
+	dir := t.TempDir()
+	cf := CLIConf{HomePath: dir}
+
+	require.NoError(t, setConfigValue(cf, false, "strict_templates", "true"))
+
+	cfg, err := loadConfig(filepath.Join(dir, tshConfigPath), cf)
+	require.NoError(t, err)
+	require.True(t, cfg.StrictTemplates)
+}
+
+func TestSetConfigValue_SequenceIndexPath(t *testing.T) {
+	dir := t.TempDir()
+	cf := CLIConf{HomePath: dir}
+
+	require.NoError(t, addConfigHeaders(cf, false, "example.com", map[string]string{"X-Foo": "bar"}))
+	require.NoError(t, setConfigValue(cf, false, "add_headers.0.proxy", "changed.example.com"))
+
+	cfg, err := loadConfig(filepath.Join(dir, tshConfigPath), cf)
+	require.NoError(t, err)
+	require.Equal(t, "changed.example.com", cfg.ExtraHeaders[0].Proxy)
+}
+
+func TestSetConfigValue_OutOfRangeIndexIsError(t *testing.T) {
+	dir := t.TempDir()
+	cf := CLIConf{HomePath: dir}
+
+	require.NoError(t, addConfigHeaders(cf, false, "example.com", map[string]string{"X-Foo": "bar"}))
+	err := setConfigValue(cf, false, "add_headers.5.proxy", "changed.example.com")
+	require.Error(t, err)
+}
+
+func TestShowTshConfig_Formats(t *testing.T) {
+	dir := t.TempDir()
+	cf := CLIConf{HomePath: dir}
+	require.NoError(t, addConfigHeaders(cf, false, "example.com", map[string]string{"X-Foo": "bar"}))
+
+	yamlOut, err := showTshConfig(cf, "yaml")
+	require.NoError(t, err)
+	require.Contains(t, yamlOut, "example.com")
+
+	jsonOut, err := showTshConfig(cf, "json")
+	require.NoError(t, err)
+	require.Contains(t, jsonOut, "example.com")
+
+	_, err = showTshConfig(cf, "xml")
+	require.Error(t, err)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gravitational/trace"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigWithIncludes_GlobbingAndPrecedence(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "includes"), 0o700))
+
+	writeTestConfig(t, dir, "includes/a.yaml", `
+add_headers:
+- proxy: a.example.com
+  headers:
+    X-From: "a"
+`)
+	writeTestConfig(t, dir, "includes/b.yaml", `
+add_headers:
+- proxy: b.example.com
+  headers:
+    X-From: "b"
+`)
+
+	path := writeTestConfig(t, dir, "config.yaml", `
+include:
+- includes/*.yaml
+add_headers:
+- proxy: parent.example.com
+  headers:
+    X-From: "parent"
+`)
+
+	cfg, err := loadConfig(path, CLIConf{})
+	require.NoError(t, err)
+	require.Len(t, cfg.ExtraHeaders, 3)
+
+	// Later includes override earlier ones, and the parent's own inline
+	// values come last (highest precedence) regardless of include order.
+	require.Equal(t, "a", cfg.ExtraHeaders[0].Headers["X-From"])
+	require.Equal(t, "b", cfg.ExtraHeaders[1].Headers["X-From"])
+	require.Equal(t, "parent", cfg.ExtraHeaders[2].Headers["X-From"])
+}
+
+func TestLoadConfigWithIncludes_MissingIncludeIsHardError(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, "config.yaml", `
+include:
+- does-not-exist/*.yaml
+`)
+
+	_, err := loadConfig(path, CLIConf{})
+	require.Error(t, err)
+	require.True(t, trace.IsBadParameter(err))
+}
+
+func TestLoadConfigWithIncludes_MissingTopLevelConfigIsNotAnError(t *testing.T) {
+	dir := t.TempDir()
+	cfg, err := loadConfig(filepath.Join(dir, "does-not-exist.yaml"), CLIConf{})
+	require.NoError(t, err)
+	require.Equal(t, &TshConfig{}, cfg)
+}
+
+func TestLoadConfigWithIncludes_CycleDetection(t *testing.T) {
+	dir := t.TempDir()
+	writeTestConfig(t, dir, "a.yaml", `
+include:
+- b.yaml
+`)
+	path := writeTestConfig(t, dir, "b.yaml", `
+include:
+- a.yaml
+`)
+
+	_, err := loadConfig(path, CLIConf{})
+	require.Error(t, err)
+	require.True(t, trace.IsBadParameter(err))
+}
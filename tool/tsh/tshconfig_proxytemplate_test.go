@@ -0,0 +1,104 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func mustCompileTemplate(t *testing.T, tmpl ProxyTemplate) ProxyTemplate {
+	t.Helper()
+	require.NoError(t, tmpl.CheckAndSetDefaults())
+	return tmpl
+}
+
+func TestApplyProxyTemplates_CaptureGroupSubstitution(t *testing.T) {
+	tmpl := mustCompileTemplate(t, ProxyTemplate{
+		Template: `^(.*)\.prod\.example\.com$`,
+		Proxy:    "proxy-prod.example.com:443",
+		Cluster:  "$1-prod",
+		Host:     "$1",
+	})
+
+	proxy, cluster, host, matched := ApplyProxyTemplates([]ProxyTemplate{tmpl}, "node1.prod.example.com")
+	require.True(t, matched)
+	require.Equal(t, "proxy-prod.example.com:443", proxy)
+	require.Equal(t, "node1-prod", cluster)
+	require.Equal(t, "node1", host)
+}
+
+func TestApplyProxyTemplates_FirstMatchWins(t *testing.T) {
+	first := mustCompileTemplate(t, ProxyTemplate{
+		Template: `.*\.example\.com$`,
+		Proxy:    "first.example.com",
+	})
+	second := mustCompileTemplate(t, ProxyTemplate{
+		Template: `.*\.example\.com$`,
+		Proxy:    "second.example.com",
+	})
+
+	proxy, _, _, matched := ApplyProxyTemplates([]ProxyTemplate{first, second}, "node.example.com")
+	require.True(t, matched)
+	require.Equal(t, "first.example.com", proxy)
+}
+
+func TestApplyProxyTemplates_NoMatch(t *testing.T) {
+	tmpl := mustCompileTemplate(t, ProxyTemplate{
+		Template: `^dev\.`,
+		Proxy:    "dev.example.com",
+	})
+
+	_, _, _, matched := ApplyProxyTemplates([]ProxyTemplate{tmpl}, "node.prod.example.com")
+	require.False(t, matched)
+}
+
+func TestResolveSSHProxyTemplate_JumpHostOverridesTemplate(t *testing.T) {
+	tmpl := mustCompileTemplate(t, ProxyTemplate{
+		Template: `.*`,
+		Proxy:    "templated.example.com",
+	})
+
+	proxy, cluster, host, matched := ResolveSSHProxyTemplate([]ProxyTemplate{tmpl}, "node.example.com", true /* hasJumpHost */, false /* quiet */)
+	require.False(t, matched)
+	require.Empty(t, proxy)
+	require.Empty(t, cluster)
+	require.Empty(t, host)
+}
+
+func TestResolveSSHProxyTemplate_MatchesWithoutJumpHost(t *testing.T) {
+	tmpl := mustCompileTemplate(t, ProxyTemplate{
+		Template: `.*`,
+		Proxy:    "templated.example.com",
+		Cluster:  "templated-cluster",
+	})
+
+	proxy, cluster, _, matched := ResolveSSHProxyTemplate([]ProxyTemplate{tmpl}, "node.example.com", false /* hasJumpHost */, true /* quiet */)
+	require.True(t, matched)
+	require.Equal(t, "templated.example.com", proxy)
+	require.Equal(t, "templated-cluster", cluster)
+}
+
+func TestMerge_ProxyTemplatesHigherPriorityFirst(t *testing.T) {
+	base := TshConfig{ProxyTemplates: []ProxyTemplate{{Template: "base"}}}
+	other := TshConfig{ProxyTemplates: []ProxyTemplate{{Template: "other"}}}
+
+	merged := base.Merge(&other)
+	require.Equal(t, "other", merged.ProxyTemplates[0].Template)
+	require.Equal(t, "base", merged.ProxyTemplates[1].Template)
+}
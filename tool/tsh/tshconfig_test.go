@@ -0,0 +1,126 @@
+/*
+Copyright 2022 Gravitational, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestConfig(t *testing.T, dir, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestLoadConfig_TemplateRendering(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TSH_TEST_TOKEN", "abc123")
+
+	path := writeTestConfig(t, dir, "config.yaml", `
+add_headers:
+- proxy: example.com
+  headers:
+    Authorization: "Bearer {{ env "TSH_TEST_TOKEN" }}"
+`)
+
+	cfg, err := loadConfig(path, CLIConf{})
+	require.NoError(t, err)
+	require.Len(t, cfg.ExtraHeaders, 1)
+	require.Equal(t, "Bearer abc123", cfg.ExtraHeaders[0].Headers["Authorization"])
+}
+
+func TestLoadConfig_NoTemplateActionsIsUnchanged(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, "config.yaml", `
+add_headers:
+- proxy: example.com
+  headers:
+    X-Literal: "plain value with a single { brace } in it, no template actions"
+`)
+
+	cfg, err := loadConfig(path, CLIConf{})
+	require.NoError(t, err)
+	require.Equal(t, "plain value with a single { brace } in it, no template actions", cfg.ExtraHeaders[0].Headers["X-Literal"])
+}
+
+func TestLoadConfig_TemplateEscapesYAMLSignificantChars(t *testing.T) {
+	dir := t.TempDir()
+	// Contains a colon, embedded double quotes and a '#', all
+	// YAML-significant, to make sure the "quote" helper produces a
+	// scalar that survives round-tripping through the YAML parser
+	// instead of corrupting the surrounding document.
+	rawValue := `a: b "quoted" # not a comment`
+	t.Setenv("TSH_TEST_VALUE", rawValue)
+
+	path := writeTestConfig(t, dir, "config.yaml", `
+add_headers:
+- proxy: example.com
+  headers:
+    X-Raw: {{ env "TSH_TEST_VALUE" | quote }}
+`)
+
+	cfg, err := loadConfig(path, CLIConf{})
+	require.NoError(t, err)
+	require.Equal(t, rawValue, cfg.ExtraHeaders[0].Headers["X-Raw"])
+}
+
+func TestLoadConfig_StrictTemplatesMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, "config.yaml", `
+strict_templates: true
+add_headers:
+- proxy: example.com
+  headers:
+    Authorization: "{{ .Env.TSH_TEST_DOES_NOT_EXIST }}"
+`)
+
+	_, err := loadConfig(path, CLIConf{})
+	require.Error(t, err)
+}
+
+func TestLoadConfig_NonStrictMissingKeyRendersEmpty(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, "config.yaml", `
+add_headers:
+- proxy: example.com
+  headers:
+    Authorization: "{{ .Env.TSH_TEST_DOES_NOT_EXIST }}"
+`)
+
+	cfg, err := loadConfig(path, CLIConf{})
+	require.NoError(t, err)
+	require.Equal(t, "", cfg.ExtraHeaders[0].Headers["Authorization"])
+}
+
+func TestLoadConfig_TemplateParseErrorIsWrapped(t *testing.T) {
+	dir := t.TempDir()
+	path := writeTestConfig(t, dir, "config.yaml", `
+add_headers:
+- proxy: example.com
+  headers:
+    Authorization: "{{ .Env.UNCLOSED "
+`)
+
+	_, err := loadConfig(path, CLIConf{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "failed to parse tsh config template")
+}